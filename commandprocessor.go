@@ -1,35 +1,58 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 const ADD_PLAYLIST = "add-playlist"
 const ADD_SONG_TO_PLAYLIST = "add-song-to-playlist"
 const REMOVE_PLAYLIST = "rm-playlist"
+const IMPORT_M3U = "import-m3u"
+const ADD_SMART_PLAYLIST = "add-smart-playlist"
+const RENAME_PLAYLIST = "rename-playlist"
+const SET_PLAYLIST_PUBLIC = "set-playlist-public"
+const REMOVE_SONG_FROM_PLAYLIST = "remove-song-from-playlist"
+const TRANSFER_PLAYLIST = "transfer-playlist"
+
+const ACTING_USER_PREFIX = "as="
 
 type CommandProcessor struct {
 	Commands  [][]string
-	DataStore *DataStore
+	DataStore DataStore
 
-	errors []error
+	errors   []error
+	warnings []error
 }
 
-func NewCommandProcessor(commands [][]string, dataStore *DataStore) CommandProcessor {
+func NewCommandProcessor(commands [][]string, dataStore DataStore) CommandProcessor {
 	return CommandProcessor{
 		Commands:  commands,
 		DataStore: dataStore,
 		errors:    []error{},
+		warnings:  []error{},
 	}
 }
 
 /* ProcessAll processes the commands passed to it.
-ProcessAll does a "best attempt" at executing as many commands as possible.
+By default, ProcessAll does a "best attempt" at executing as many commands as possible.
 Any errors encountered will be returned in a list after it completes the entire list.
 This means if a later command depends on a previous one that has failed, it will also fail.
-Any errors encountered during ProcessAll can be grabbed later by calling `Errors()` */
-func (cp *CommandProcessor) ProcessAll() error {
-	cp.errors = []error{} // reset errors from any previous run
+Any errors encountered during ProcessAll can be grabbed later by calling `Errors()`
+
+If `atomic` is true, the batch is all-or-nothing instead: if any command fails, every
+mutation made by the batch so far is rolled back via DataStore's Snapshot/Restore, and the
+data store is left exactly as it was before ProcessAll was called. */
+func (cp *CommandProcessor) ProcessAll(atomic bool) error {
+	cp.errors = []error{}   // reset errors from any previous run
+	cp.warnings = []error{} // reset warnings from any previous run
+
+	var snapshot DataStoreSnapshot
+	if atomic {
+		snapshot = cp.DataStore.Snapshot()
+	}
 
 	for _, command := range cp.Commands {
 		if err := cp.ProcessCommand(command); err != nil {
@@ -38,31 +61,49 @@ func (cp *CommandProcessor) ProcessAll() error {
 	}
 
 	if len(cp.errors) != 0 {
+		if atomic {
+			cp.DataStore.Restore(snapshot)
+		}
+
 		return fmt.Errorf("At least one error was encountered. See CommandProcessor.Errors()")
 	}
 
 	return nil
 }
 
+/* ProcessCommand processes a single command row. The row's first field must be the acting
+user, written as `as=<user-id>` (e.g. `as=1,rm-playlist,3`) - it's stripped off and passed to
+the command's handler, which uses it to enforce playlist ownership/ACLs. */
 func (cp *CommandProcessor) ProcessCommand(command []string) error {
 	if len(command) == 0 {
 		return fmt.Errorf("Can't process empty command")
 	}
 
-	commandHandlers := map[string]func([]string) error{
-		ADD_PLAYLIST:         cp.addNewPlaylist,
-		ADD_SONG_TO_PLAYLIST: cp.addSongToPlaylist,
-		REMOVE_PLAYLIST:      cp.removePlaylist,
+	actingUserId, rest, err := parseActingUser(command)
+	if err != nil {
+		return err
 	}
 
-	baseCommand := command[0]
+	commandHandlers := map[string]func(string, []string) error{
+		ADD_PLAYLIST:              cp.addNewPlaylist,
+		ADD_SONG_TO_PLAYLIST:      cp.addSongToPlaylist,
+		REMOVE_PLAYLIST:           cp.removePlaylist,
+		IMPORT_M3U:                cp.importM3U,
+		ADD_SMART_PLAYLIST:        cp.addSmartPlaylist,
+		RENAME_PLAYLIST:           cp.renamePlaylist,
+		SET_PLAYLIST_PUBLIC:       cp.setPlaylistPublic,
+		REMOVE_SONG_FROM_PLAYLIST: cp.removeSongFromPlaylist,
+		TRANSFER_PLAYLIST:         cp.transferPlaylist,
+	}
+
+	baseCommand := rest[0]
 	commandHandler, exists := commandHandlers[baseCommand]
 	if !exists {
 		return fmt.Errorf("Unrecognized command: `%v`\n", baseCommand)
 	}
 
-	if err := commandHandler(command); err != nil {
-		return fmt.Errorf("Problem with `%v`: %v\n", command, err)
+	if err := commandHandler(actingUserId, rest); err != nil {
+		return fmt.Errorf("Problem with `%v`: %v\n", rest, err)
 	}
 
 	return nil
@@ -72,8 +113,35 @@ func (cp CommandProcessor) Errors() []error {
 	return cp.errors
 }
 
+// Warnings returns non-fatal problems noticed while processing commands, e.g. M3U entries
+// that couldn't be resolved to an existing song. Unlike Errors(), these don't cause
+// ProcessAll to report failure or roll back an atomic batch.
+func (cp CommandProcessor) Warnings() []error {
+	return cp.warnings
+}
+
+// parseActingUser splits the leading `as=<user-id>` field off of a command row and returns
+// the acting user id alongside the remaining fields (the actual command and its arguments).
+func parseActingUser(command []string) (actingUserId string, rest []string, err error) {
+	actingUserId = strings.TrimPrefix(command[0], ACTING_USER_PREFIX)
+	if actingUserId == command[0] {
+		return "", nil, fmt.Errorf("Command row must start with `%v<user-id>`, got `%v`", ACTING_USER_PREFIX, command[0])
+	}
+
+	if actingUserId == "" {
+		return "", nil, fmt.Errorf("`%v` field must specify a user id", ACTING_USER_PREFIX)
+	}
+
+	rest = command[1:]
+	if len(rest) == 0 {
+		return "", nil, fmt.Errorf("Can't process empty command")
+	}
+
+	return actingUserId, rest, nil
+}
+
 // Command format: []string{ADD_PLAYLIST, "playlist-id", "song-id-1", "song-id-2", ..., "song-id-N"}
-func (cp *CommandProcessor) addNewPlaylist(command []string) error {
+func (cp *CommandProcessor) addNewPlaylist(actingUserId string, command []string) error {
 	if len(command) < 3 {
 		return fmt.Errorf("Incorrect number of arguments for `%v`", command[0])
 	}
@@ -81,7 +149,7 @@ func (cp *CommandProcessor) addNewPlaylist(command []string) error {
 	userId := command[1]
 	songIds := command[2:]
 
-	if _, err := cp.DataStore.AddNewPlaylist(userId, songIds); err != nil {
+	if _, err := cp.DataStore.AddNewPlaylist(actingUserId, userId, songIds); err != nil {
 		return err
 	}
 
@@ -89,14 +157,14 @@ func (cp *CommandProcessor) addNewPlaylist(command []string) error {
 }
 
 // Command format: []string{REMOVE_PLAYLIST, "playlist-id"}
-func (cp *CommandProcessor) removePlaylist(command []string) error {
+func (cp *CommandProcessor) removePlaylist(actingUserId string, command []string) error {
 	if len(command) != 2 {
 		return fmt.Errorf("Incorrect number of arguments for `%v` command", command[0])
 	}
 
 	playlistId := command[1]
 
-	if _, err := cp.DataStore.RemovePlaylist(playlistId); err != nil {
+	if _, err := cp.DataStore.RemovePlaylist(actingUserId, playlistId); err != nil {
 		return err
 	}
 
@@ -104,7 +172,7 @@ func (cp *CommandProcessor) removePlaylist(command []string) error {
 }
 
 // Command format: []string{ADD_SONG_TO_PLAYLIST, "playlist-id", "song-id"}
-func (cp *CommandProcessor) addSongToPlaylist(command []string) error {
+func (cp *CommandProcessor) addSongToPlaylist(actingUserId string, command []string) error {
 	if len(command) != 3 {
 		return fmt.Errorf("Incorrect number of arguments for `%v` command", command[0])
 	}
@@ -112,5 +180,110 @@ func (cp *CommandProcessor) addSongToPlaylist(command []string) error {
 	playlistId := command[1]
 	songId := command[2]
 
-	return cp.DataStore.AddSongToPlaylist(playlistId, songId)
+	return cp.DataStore.AddSongToPlaylist(actingUserId, playlistId, songId)
+}
+
+// Command format: []string{REMOVE_SONG_FROM_PLAYLIST, "playlist-id", "index"}
+// `index` counts song entries the same way the user sees them in M3U order.
+func (cp *CommandProcessor) removeSongFromPlaylist(actingUserId string, command []string) error {
+	if len(command) != 3 {
+		return fmt.Errorf("Incorrect number of arguments for `%v` command", command[0])
+	}
+
+	playlistId := command[1]
+
+	index, err := strconv.Atoi(command[2])
+	if err != nil {
+		return fmt.Errorf("Song index must be an integer: %v", err)
+	}
+
+	return cp.DataStore.RemoveSongFromPlaylist(actingUserId, playlistId, index)
+}
+
+// Command format: []string{RENAME_PLAYLIST, "playlist-id", "new-comment"}
+func (cp *CommandProcessor) renamePlaylist(actingUserId string, command []string) error {
+	if len(command) != 3 {
+		return fmt.Errorf("Incorrect number of arguments for `%v` command", command[0])
+	}
+
+	playlistId := command[1]
+	comment := command[2]
+
+	return cp.DataStore.RenamePlaylist(actingUserId, playlistId, comment)
+}
+
+// Command format: []string{SET_PLAYLIST_PUBLIC, "playlist-id", "true"|"false"}
+func (cp *CommandProcessor) setPlaylistPublic(actingUserId string, command []string) error {
+	if len(command) != 3 {
+		return fmt.Errorf("Incorrect number of arguments for `%v` command", command[0])
+	}
+
+	playlistId := command[1]
+
+	public, err := strconv.ParseBool(command[2])
+	if err != nil {
+		return fmt.Errorf("Expected `true` or `false`: %v", err)
+	}
+
+	return cp.DataStore.SetPlaylistPublic(actingUserId, playlistId, public)
+}
+
+// Command format: []string{TRANSFER_PLAYLIST, "playlist-id", "new-owner-user-id"}
+// Admin-only: `actingUserId` must be in the data store's admin list.
+func (cp *CommandProcessor) transferPlaylist(actingUserId string, command []string) error {
+	if len(command) != 3 {
+		return fmt.Errorf("Incorrect number of arguments for `%v` command", command[0])
+	}
+
+	playlistId := command[1]
+	newOwnerId := command[2]
+
+	return cp.DataStore.TransferPlaylist(actingUserId, playlistId, newOwnerId)
+}
+
+// Command format: []string{IMPORT_M3U, "user-id", "path/to/playlist.m3u"}
+// Entries in the M3U file that can't be resolved to an existing song are recorded as
+// processor warnings (see Warnings()) rather than aborting the whole import.
+func (cp *CommandProcessor) importM3U(actingUserId string, command []string) error {
+	if len(command) != 3 {
+		return fmt.Errorf("Incorrect number of arguments for `%v` command", command[0])
+	}
+
+	userId := command[1]
+	m3uFilename := command[2]
+
+	_, unresolved, err := ImportM3U(cp.DataStore, actingUserId, userId, m3uFilename)
+	cp.warnings = append(cp.warnings, unresolved...)
+
+	return err
+}
+
+// smartPlaylistSpec is the shape of the JSON blob carried by an ADD_SMART_PLAYLIST command.
+// Criteria is embedded so its "all"/"any"/"not"/"field"/"op"/"value" keys sit alongside
+// "sort" and "limit" in a single flat object, matching how a smart playlist reads as a rule.
+type smartPlaylistSpec struct {
+	Criteria
+	Sort  string `json:"sort,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// Command format: []string{ADD_SMART_PLAYLIST, "user-id", "<criteria-json>"}
+// See smartPlaylistSpec for the shape of the criteria JSON.
+func (cp *CommandProcessor) addSmartPlaylist(actingUserId string, command []string) error {
+	if len(command) != 3 {
+		return fmt.Errorf("Incorrect number of arguments for `%v` command", command[0])
+	}
+
+	userId := command[1]
+
+	var spec smartPlaylistSpec
+	if err := json.Unmarshal([]byte(command[2]), &spec); err != nil {
+		return fmt.Errorf("Problem parsing smart playlist criteria: %v", err)
+	}
+
+	if _, err := cp.DataStore.AddSmartPlaylist(actingUserId, userId, spec.Criteria, spec.Sort, spec.Limit); err != nil {
+		return err
+	}
+
+	return nil
 }
@@ -5,7 +5,7 @@ import (
 )
 
 func TestNewDataStoreFromFile(t *testing.T) {
-	dataStore, err := NewDataStoreFromFile("testtape.json")
+	dataStore, err := newJSONDataStoreFromFile("testtape.json")
 	if err != nil {
 		t.Error("Error during data store file read: ", err)
 	}
@@ -42,18 +42,18 @@ func TestNewDataStoreFromFile(t *testing.T) {
 }
 
 func TestRemovePlaylist(t *testing.T) {
-	dataStore, err := NewDataStoreFromFile("testtape.json")
+	dataStore, err := newJSONDataStoreFromFile("testtape.json")
 	if err != nil {
 		t.Error("Error during data store file read: ", err)
 	}
 
-	if removed, err := dataStore.RemovePlaylist("1"); err != nil || !removed {
+	if removed, err := dataStore.RemovePlaylist("1", "1"); err != nil || !removed {
 		t.Error("Failed to remove playlist '1'")
 	}
 	if len(dataStore.Playlists) != 2 {
 		t.Error("Didn't actually remove the playlist")
 	}
-	if removed, err := dataStore.RemovePlaylist("1"); err != nil || removed {
+	if removed, err := dataStore.RemovePlaylist("1", "1"); err != nil || removed {
 		t.Error("Should be ok to call remove playlist '1' twice but method should return `false` the second time")
 	}
 	if dataStore.Playlists[0].Id != "3" || dataStore.Playlists[1].Id != "2" {
@@ -62,47 +62,53 @@ func TestRemovePlaylist(t *testing.T) {
 }
 
 func TestAddNewPlaylist(t *testing.T) {
-	dataStore, err := NewDataStoreFromFile("testtape.json")
+	dataStore, err := newJSONDataStoreFromFile("testtape.json")
 	if err != nil {
 		t.Error("Error during data store file read: ", err)
 	}
 
-	if _, err := dataStore.AddNewPlaylist("bad-id", []string{"1", "2"}); err == nil {
+	if _, err := dataStore.AddNewPlaylist("bad-id", "bad-id", []string{"1", "2"}); err == nil {
 		t.Error("AddNewPlaylist not failing when user id doesn't exist in store")
 	}
-	if _, err := dataStore.AddNewPlaylist("1", []string{"bad-id", "2"}); err == nil {
+	if _, err := dataStore.AddNewPlaylist("1", "1", []string{"bad-id", "2"}); err == nil {
 		t.Error("AddNewPlaylist not failing when song id doesn't exist in store")
 	}
-	if _, err := dataStore.AddNewPlaylist("1", []string{}); err == nil {
+	if _, err := dataStore.AddNewPlaylist("1", "1", []string{}); err == nil {
 		t.Error("AddNewPlaylist not failing when the song id list is empty")
 	}
+	if _, err := dataStore.AddNewPlaylist("2", "1", []string{"1", "2"}); err == nil {
+		t.Error("AddNewPlaylist not failing when the acting user isn't the owner or an admin")
+	}
 
-	newPlaylistId, err := dataStore.AddNewPlaylist("1", []string{"1", "2"})
+	newPlaylistId, err := dataStore.AddNewPlaylist("1", "1", []string{"1", "2"})
 	if err != nil || newPlaylistId != "4" {
 		t.Error("AddNewPlaylist not adding playlist as expected")
 	}
 }
 
 func TestAddSongToPlaylist(t *testing.T) {
-	dataStore, err := NewDataStoreFromFile("testtape.json")
+	dataStore, err := newJSONDataStoreFromFile("testtape.json")
 	if err != nil {
 		t.Error("Error during data store file read: ", err)
 	}
 
-	if err := dataStore.AddSongToPlaylist("bad-id", "1"); err == nil {
+	if err := dataStore.AddSongToPlaylist("1", "1", "bad-id"); err == nil {
 		t.Error("AddSongToPlaylist should fail when song id is invalid")
 	}
-	if err := dataStore.AddSongToPlaylist("1", "bad-id"); err == nil {
+	if err := dataStore.AddSongToPlaylist("1", "bad-id", "1"); err == nil {
 		t.Error("AddSongToPlaylist should fail when playlist id is invalid")
 	}
+	if err := dataStore.AddSongToPlaylist("2", "1", "1"); err == nil {
+		t.Error("AddSongToPlaylist should fail when the acting user isn't the owner or an admin")
+	}
 
-	if err := dataStore.AddSongToPlaylist("1", "1"); err != nil {
+	if err := dataStore.AddSongToPlaylist("1", "1", "1"); err != nil {
 		t.Error("Problem adding song to playlist")
 	}
-	if err := dataStore.AddSongToPlaylist("1", "1"); err != nil {
+	if err := dataStore.AddSongToPlaylist("1", "1", "1"); err != nil {
 		t.Error("Problem adding song to playlist")
 	}
-	if err := dataStore.AddSongToPlaylist("1", "1"); err != nil {
+	if err := dataStore.AddSongToPlaylist("1", "1", "1"); err != nil {
 		t.Error("Problem adding song to playlist")
 	}
 
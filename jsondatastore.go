@@ -0,0 +1,447 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+/* jsonDataStore is the original DataStore implementation: it (de)serializes the whole tape
+to/from a JSON file and keeps everything in memory.
+
+As a reminder, by default, Go serializes *only* public attritutes, which are those that begin with
+a capital letter. In this case, only Users, Playlists, SmartPlaylists, Songs, and Admins are
+(de)serialized. The rest are private and used for the manipulation logic.
+
+jsonDataStore maintains internal look-up tables which serve as indexes for Users, Playlists, and Songs.
+*/
+type jsonDataStore struct {
+	Users          []User          `json:"users"`
+	Playlists      []Playlist      `json:"playlists"`
+	SmartPlaylists []SmartPlaylist `json:"smart_playlists"`
+	Songs          []Song          `json:"songs"`
+	Admins         []string        `json:"admins,omitempty"` // user ids allowed to mutate any playlist
+
+	userMap          map[string]int
+	playlistMap      map[string]int
+	smartPlaylistMap map[string]int
+	songMap          map[string]int
+	songKeyMap       map[string]int // keyed by songLookupKey(artist, title), for M3U import resolution
+	adminSet         map[string]bool
+
+	nextPlaylistId      int
+	nextSmartPlaylistId int
+}
+
+// newJSONDataStoreFromFile reads `inputFilename` as JSON and builds its lookup tables.
+func newJSONDataStoreFromFile(inputFilename string) (*jsonDataStore, error) {
+	data, err := ioutil.ReadFile(inputFilename)
+	if err != nil {
+		return &jsonDataStore{}, err
+	}
+
+	var ds *jsonDataStore
+	if err := json.Unmarshal(data, &ds); err != nil {
+		return ds, err
+	}
+
+	if err := ds.buildLookupTables(); err != nil {
+		return ds, err
+	}
+
+	return ds, nil
+}
+
+func (ds *jsonDataStore) buildLookupTables() error {
+	// Users lookup table
+	ds.userMap = make(map[string]int)
+	for i, user := range ds.Users {
+		ds.userMap[user.Id] = i
+	}
+
+	// Songs lookup table
+	ds.songMap = make(map[string]int)
+	ds.songKeyMap = make(map[string]int)
+	for i, song := range ds.Songs {
+		ds.songMap[song.Id] = i
+		ds.songKeyMap[songLookupKey(song.Artist, song.Title)] = i
+	}
+
+	// Playlists lookup table
+	// This code also take advantages of the required O(n) loop and determines the initial value
+	//   for `nextPlaylistId` by adding 1 to the highest id found
+	// Also an opportunity to verify that playlists don't refer to non-existant user or song ids,
+	//   and to backfill OwnerID from UserId for playlists written before ownership existed
+	ds.playlistMap = make(map[string]int)
+	var maxPlaylistId = 0
+	for i, playlist := range ds.Playlists {
+		ds.playlistMap[playlist.Id] = i
+
+		if _, exists := ds.userMap[playlist.UserId]; !exists {
+			return fmt.Errorf("Playlist `%v` refers to a non-existant user id `%v`", playlist.Id, playlist.UserId)
+		}
+		for _, songId := range playlist.SongIds {
+			if _, exists := ds.songMap[songId]; !exists {
+				return fmt.Errorf("Playlist `%v` refers to a non-existant song id `%v`", playlist.Id, songId)
+			}
+		}
+
+		if playlist.OwnerID == "" {
+			ds.Playlists[i].OwnerID = playlist.UserId
+		}
+
+		if intId, err := strconv.Atoi(playlist.Id); err != nil {
+			return err
+		} else if intId > maxPlaylistId {
+			maxPlaylistId = intId
+		}
+	}
+
+	ds.nextPlaylistId = maxPlaylistId + 1
+
+	// SmartPlaylists lookup table, following the same pattern as the Playlists table above
+	ds.smartPlaylistMap = make(map[string]int)
+	var maxSmartPlaylistId = 0
+	for i, smartPlaylist := range ds.SmartPlaylists {
+		ds.smartPlaylistMap[smartPlaylist.Id] = i
+
+		if intId, err := strconv.Atoi(smartPlaylist.Id); err != nil {
+			return err
+		} else if intId > maxSmartPlaylistId {
+			maxSmartPlaylistId = intId
+		}
+	}
+
+	ds.nextSmartPlaylistId = maxSmartPlaylistId + 1
+
+	// Admins lookup table
+	ds.adminSet = make(map[string]bool, len(ds.Admins))
+	for _, adminId := range ds.Admins {
+		ds.adminSet[adminId] = true
+	}
+
+	return nil
+}
+
+// isAdmin reports whether userId is in Admins, and is therefore allowed to mutate any
+// playlist regardless of ownership.
+func (ds *jsonDataStore) isAdmin(userId string) bool {
+	return ds.adminSet[userId]
+}
+
+func (ds *jsonDataStore) GetUser(id string) (User, bool) {
+	index, exists := ds.userMap[id]
+	if !exists {
+		return User{}, false
+	}
+
+	return ds.Users[index], true
+}
+
+func (ds *jsonDataStore) GetSong(id string) (Song, bool) {
+	index, exists := ds.songMap[id]
+	if !exists {
+		return Song{}, false
+	}
+
+	return ds.Songs[index], true
+}
+
+func (ds *jsonDataStore) GetAllSongs() []Song {
+	return ds.Songs
+}
+
+/* FindSongByArtistTitle looks up a song by artist and title using the songKeyMap index.
+The lookup is case-insensitive and ignores leading/trailing whitespace. The second return
+value is `false` if no matching song exists. */
+func (ds *jsonDataStore) FindSongByArtistTitle(artist string, title string) (Song, bool) {
+	index, exists := ds.songKeyMap[songLookupKey(artist, title)]
+	if !exists {
+		return Song{}, false
+	}
+
+	return ds.Songs[index], true
+}
+
+func (ds *jsonDataStore) GetPlaylist(id string) (Playlist, bool) {
+	index, exists := ds.playlistMap[id]
+	if !exists {
+		return Playlist{}, false
+	}
+
+	return ds.Playlists[index], true
+}
+
+func (ds *jsonDataStore) GetAllPlaylists() []Playlist {
+	return ds.Playlists
+}
+
+func (ds *jsonDataStore) GetSmartPlaylist(id string) (SmartPlaylist, bool) {
+	index, exists := ds.smartPlaylistMap[id]
+	if !exists {
+		return SmartPlaylist{}, false
+	}
+
+	return ds.SmartPlaylists[index], true
+}
+
+/* WriteToFile persists the data store to the file specified by `outputFilename`.
+See the mid-method constant `OUT_FILE_PERMISSIONS` for the permissions used when creating the file.
+An error can be returned if the file cannot be written for any reason. */
+func (ds *jsonDataStore) WriteToFile(outputFilename string) error {
+	const PREFIX_STRING = ""
+	const INDENT_STRING = "  " // Note: That's two spaces, not one
+	dataStoreAsJSON, err := json.MarshalIndent(ds, PREFIX_STRING, INDENT_STRING)
+	if err != nil {
+		return err
+	}
+
+	// Standard Unix rwxrwxrwx style permissions, 0644 = user: r+w, group: r, other: r
+	const OUT_FILE_PERMISSIONS os.FileMode = 0644
+	if err := ioutil.WriteFile(outputFilename, dataStoreAsJSON, OUT_FILE_PERMISSIONS); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+/* RemovePlaylist removes a playlist from the data store. Removing the same playlist ID twice
+has no additional effect and is allowed.
+RemovePlaylist returns `true` if the playlist was removed and `false` if no action was taken.
+An error is returned if the playlist exists but `actingUserId` is neither its owner nor an admin.
+
+In order to avoid copying memory over to fill the gap of the removed playlist from the slice (internally
+represented as an array by Go), this method simply overwrites the playlist to be removed with the last
+playlist in the slice/array. Then the last playlist (which was jus copied into the old "gap") is removed.
+This keeps the operation as O(1) time vs O(n).
+The trade-off is that the order of the playlists is not maintained. Because of the nature of this program
+and the use cases required, this is an acceptable trade-off.
+*/
+func (ds *jsonDataStore) RemovePlaylist(actingUserId string, id string) (bool, error) {
+	targetPlaylistIndex, ok := ds.playlistMap[id]
+	if !ok {
+		return false, nil
+	}
+
+	if err := authorizePlaylistMutation(actingUserId, ds.Playlists[targetPlaylistIndex], ds.isAdmin(actingUserId)); err != nil {
+		return false, err
+	}
+
+	lastIndex := len(ds.Playlists) - 1
+	lastPlaylist := ds.Playlists[lastIndex]
+
+	// remove the playlist from the list of playlists
+	ds.Playlists[targetPlaylistIndex] = lastPlaylist
+	ds.Playlists = ds.Playlists[:lastIndex]
+
+	// Update the playlist map
+	delete(ds.playlistMap, id)
+	ds.playlistMap[lastPlaylist.Id] = targetPlaylistIndex
+
+	return true, nil
+}
+
+/* AddNewPlaylist adds a new playlist, owned by `userId`, to the data store.
+Returns the ID of the new playlist.
+An error will be returned in the following cases:
+- `actingUserId` is neither `userId` nor an admin.
+- The user ID does not exist.
+- At least one sing ID was provided that doesn't exist.
+- Playlists without at least one song are not allowed. */
+func (ds *jsonDataStore) AddNewPlaylist(actingUserId string, userId string, songIds []string) (string, error) {
+	if actingUserId != userId && !ds.isAdmin(actingUserId) {
+		return "", fmt.Errorf("User `%v` is not authorized to create a playlist owned by `%v`", actingUserId, userId)
+	}
+
+	if _, exists := ds.userMap[userId]; !exists {
+		return "", fmt.Errorf("The user id does not exist")
+	}
+
+	if len(songIds) == 0 {
+		return "", fmt.Errorf("A playlist must contain at least one song (zero sing IDs were provided)")
+	}
+
+	for _, songId := range songIds {
+		if _, exists := ds.songMap[songId]; !exists {
+			return "", fmt.Errorf("One or more of the song IDs provided is invalid")
+		}
+	}
+
+	// Make a copy of the song IDs to prevent the caller from accidentally modifying the song
+	// IDs after they've been stored.
+	songIdsCopy := make([]string, len(songIds))
+	copy(songIdsCopy, songIds)
+
+	newPlaylist := Playlist{
+		Id:      ds.generatePlaylistId(),
+		UserId:  userId,
+		OwnerID: userId,
+		SongIds: songIdsCopy,
+	}
+
+	ds.Playlists = append(ds.Playlists, newPlaylist)
+	ds.playlistMap[newPlaylist.Id] = len(ds.Playlists) - 1
+
+	return newPlaylist.Id, nil
+}
+
+/* AddSongToPlaylist adds an existing song id to a playlist. Duplicate songs are allowed.
+An error will be returned in the following cases:
+- Song ID doesn't exist
+- Playlist ID doesn't exist
+- `actingUserId` is neither the playlist's owner nor an admin */
+func (ds *jsonDataStore) AddSongToPlaylist(actingUserId string, playlistId string, songId string) error {
+	if _, exists := ds.songMap[songId]; !exists {
+		return fmt.Errorf("Song id does not exist")
+	}
+
+	playlistIndex, exists := ds.playlistMap[playlistId]
+	if !exists {
+		return fmt.Errorf("Playlist id does not exist")
+	}
+
+	if err := authorizePlaylistMutation(actingUserId, ds.Playlists[playlistIndex], ds.isAdmin(actingUserId)); err != nil {
+		return err
+	}
+
+	songIds := ds.Playlists[playlistIndex].SongIds
+	ds.Playlists[playlistIndex].SongIds = append(songIds, songId)
+
+	return nil
+}
+
+/* RemoveSongFromPlaylist removes the song at `index` (as the user would count entries in
+the M3U order) from a playlist.
+An error will be returned in the following cases:
+- Playlist ID doesn't exist
+- `index` is out of range for the playlist's current SongIds
+- `actingUserId` is neither the playlist's owner nor an admin */
+func (ds *jsonDataStore) RemoveSongFromPlaylist(actingUserId string, playlistId string, index int) error {
+	playlistIndex, exists := ds.playlistMap[playlistId]
+	if !exists {
+		return fmt.Errorf("Playlist id does not exist")
+	}
+
+	if err := authorizePlaylistMutation(actingUserId, ds.Playlists[playlistIndex], ds.isAdmin(actingUserId)); err != nil {
+		return err
+	}
+
+	songIds := ds.Playlists[playlistIndex].SongIds
+	if index < 0 || index >= len(songIds) {
+		return fmt.Errorf("Song index %v is out of range for playlist `%v`", index, playlistId)
+	}
+
+	ds.Playlists[playlistIndex].SongIds = append(songIds[:index:index], songIds[index+1:]...)
+
+	return nil
+}
+
+/* RenamePlaylist sets a playlist's Comment, which doubles as its display name since Playlist
+doesn't have a dedicated name field.
+An error will be returned in the following cases:
+- Playlist ID doesn't exist
+- `actingUserId` is neither the playlist's owner nor an admin */
+func (ds *jsonDataStore) RenamePlaylist(actingUserId string, playlistId string, comment string) error {
+	playlistIndex, exists := ds.playlistMap[playlistId]
+	if !exists {
+		return fmt.Errorf("Playlist id does not exist")
+	}
+
+	if err := authorizePlaylistMutation(actingUserId, ds.Playlists[playlistIndex], ds.isAdmin(actingUserId)); err != nil {
+		return err
+	}
+
+	ds.Playlists[playlistIndex].Comment = comment
+
+	return nil
+}
+
+/* SetPlaylistPublic sets a playlist's Public flag.
+An error will be returned in the following cases:
+- Playlist ID doesn't exist
+- `actingUserId` is neither the playlist's owner nor an admin */
+func (ds *jsonDataStore) SetPlaylistPublic(actingUserId string, playlistId string, public bool) error {
+	playlistIndex, exists := ds.playlistMap[playlistId]
+	if !exists {
+		return fmt.Errorf("Playlist id does not exist")
+	}
+
+	if err := authorizePlaylistMutation(actingUserId, ds.Playlists[playlistIndex], ds.isAdmin(actingUserId)); err != nil {
+		return err
+	}
+
+	ds.Playlists[playlistIndex].Public = public
+
+	return nil
+}
+
+/* TransferPlaylist changes a playlist's OwnerID. Unlike the other playlist mutations, this
+is admin-only: an owner can't transfer a playlist away on their own.
+An error will be returned in the following cases:
+- `actingUserId` is not an admin
+- Playlist ID doesn't exist
+- The new owner's user ID does not exist */
+func (ds *jsonDataStore) TransferPlaylist(actingUserId string, playlistId string, newOwnerId string) error {
+	if !ds.isAdmin(actingUserId) {
+		return fmt.Errorf("User `%v` is not authorized to transfer playlist ownership (admin-only)", actingUserId)
+	}
+
+	playlistIndex, exists := ds.playlistMap[playlistId]
+	if !exists {
+		return fmt.Errorf("Playlist id does not exist")
+	}
+
+	if _, exists := ds.userMap[newOwnerId]; !exists {
+		return fmt.Errorf("The new owner's user id does not exist")
+	}
+
+	ds.Playlists[playlistIndex].OwnerID = newOwnerId
+
+	return nil
+}
+
+func (ds *jsonDataStore) generatePlaylistId() string {
+	playlistId := ds.nextPlaylistId
+	ds.nextPlaylistId += 1
+
+	return strconv.Itoa(playlistId)
+}
+
+func (ds *jsonDataStore) generateSmartPlaylistId() string {
+	smartPlaylistId := ds.nextSmartPlaylistId
+	ds.nextSmartPlaylistId += 1
+
+	return strconv.Itoa(smartPlaylistId)
+}
+
+/* AddSmartPlaylist adds a new smart playlist to the data store. Unlike AddNewPlaylist, no
+song IDs are validated up front: matches are resolved lazily by ResolveSmartPlaylist
+whenever the smart playlist is read.
+Returns the ID of the new smart playlist.
+An error will be returned in the following cases:
+- `actingUserId` is neither `userId` nor an admin.
+- The user ID does not exist. */
+func (ds *jsonDataStore) AddSmartPlaylist(actingUserId string, userId string, criteria Criteria, sort string, limit int) (string, error) {
+	if actingUserId != userId && !ds.isAdmin(actingUserId) {
+		return "", fmt.Errorf("User `%v` is not authorized to create a smart playlist owned by `%v`", actingUserId, userId)
+	}
+
+	if _, exists := ds.userMap[userId]; !exists {
+		return "", fmt.Errorf("The user id does not exist")
+	}
+
+	newSmartPlaylist := SmartPlaylist{
+		Id:       ds.generateSmartPlaylistId(),
+		UserId:   userId,
+		Criteria: criteria,
+		Sort:     sort,
+		Limit:    limit,
+	}
+
+	ds.SmartPlaylists = append(ds.SmartPlaylists, newSmartPlaylist)
+	ds.smartPlaylistMap[newSmartPlaylist.Id] = len(ds.SmartPlaylists) - 1
+
+	return newSmartPlaylist.Id, nil
+}
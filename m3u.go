@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const extinfPrefix = "#EXTINF:"
+
+// M3UEntry represents a single entry parsed from an M3U/M3U8 playlist file, before it has
+// been matched against the DataStore's songs.
+type M3UEntry struct {
+	Artist string
+	Title  string
+	Path   string
+}
+
+/* ParseM3UFile reads an M3U or M3U8 playlist file and returns the entries it contains.
+Blank lines and `#` comment lines are skipped, except `#EXTINF:` lines, which carry
+`duration,Artist - Title` and label the entry immediately following them.
+Entries may be plain file paths or `file://` URLs. When an entry has no preceding
+`#EXTINF:` line, its artist and title are derived from the "Artist - Title" filename
+convention instead.
+An error is returned if the file cannot be opened or read. */
+func ParseM3UFile(filename string) ([]M3UEntry, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't open M3U file: %v", err)
+	}
+	defer file.Close()
+
+	var entries []M3UEntry
+	var pendingArtist, pendingTitle string
+	havePending := false
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, extinfPrefix) {
+			pendingArtist, pendingTitle = parseExtinf(line)
+			havePending = true
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		path := resolveM3UPath(line)
+
+		artist, title := pendingArtist, pendingTitle
+		if !havePending {
+			artist, title = artistTitleFromFilename(path)
+		}
+
+		entries = append(entries, M3UEntry{Artist: artist, Title: title, Path: path})
+
+		pendingArtist, pendingTitle = "", ""
+		havePending = false
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Problem reading M3U file: %v", err)
+	}
+
+	return entries, nil
+}
+
+// parseExtinf parses the `duration,Artist - Title` payload of an `#EXTINF:` line.
+func parseExtinf(line string) (artist string, title string) {
+	payload := strings.TrimPrefix(line, extinfPrefix)
+
+	_, info, found := strings.Cut(payload, ",")
+	if !found {
+		return "", ""
+	}
+
+	artist, title, found = strings.Cut(info, " - ")
+	if !found {
+		return "", strings.TrimSpace(info)
+	}
+
+	return strings.TrimSpace(artist), strings.TrimSpace(title)
+}
+
+// resolveM3UPath converts a `file://` URL entry to a plain filesystem path. Plain path
+// entries are returned unchanged.
+func resolveM3UPath(entry string) string {
+	if strings.HasPrefix(entry, "file://") {
+		return strings.TrimPrefix(entry, "file://")
+	}
+
+	return entry
+}
+
+// artistTitleFromFilename derives an artist/title pair from a path using the
+// "Artist - Title" filename convention, for entries with no `#EXTINF:` line.
+func artistTitleFromFilename(path string) (artist string, title string) {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	artist, title, found := strings.Cut(base, " - ")
+	if !found {
+		return "", base
+	}
+
+	return strings.TrimSpace(artist), strings.TrimSpace(title)
+}
+
+/* ImportM3U parses the M3U/M3U8 file at `m3uFilename` and creates a new playlist owned by
+`userId` from the songs it's able to resolve via ds.FindSongByArtistTitle. Entries that
+can't be resolved to an existing song are not treated as fatal: they're skipped and
+returned as the `unresolved` slice instead of aborting the whole import.
+It's a free function rather than a DataStore method since importing only needs
+FindSongByArtistTitle and AddNewPlaylist, and keeping it standalone avoids growing the DataStore interface for a
+single caller.
+An error is returned if the file can't be parsed, or if AddNewPlaylist rejects the import
+(e.g. `actingUserId` isn't authorized to create a playlist for `userId`, or no entries could
+be resolved, leaving zero songs for the new playlist). */
+func ImportM3U(ds DataStore, actingUserId string, userId string, m3uFilename string) (playlistId string, unresolved []error, err error) {
+	entries, err := ParseM3UFile(m3uFilename)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var songIds []string
+	for _, entry := range entries {
+		song, found := ds.FindSongByArtistTitle(entry.Artist, entry.Title)
+		if !found {
+			unresolved = append(unresolved, fmt.Errorf("Couldn't resolve M3U entry to an existing song: `%v - %v` (%v)", entry.Artist, entry.Title, entry.Path))
+			continue
+		}
+
+		songIds = append(songIds, song.Id)
+	}
+
+	playlistId, err = ds.AddNewPlaylist(actingUserId, userId, songIds)
+	if err != nil {
+		return "", unresolved, err
+	}
+
+	return playlistId, unresolved, nil
+}
@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"reflect"
 )
 
 const (
@@ -14,7 +15,17 @@ const (
 )
 
 func main() {
-	dataStoreInputFilename, dataStoreOutputFilename, changesFilename := GetCommandLineArgsOrExit()
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
+	dataStoreInputFilename, dataStoreOutputFilename, changesFilename, atomic, dryRun := GetCommandLineArgsOrExit()
 
 	dataStore, err := NewDataStoreFromFile(dataStoreInputFilename)
 	if err != nil {
@@ -28,12 +39,32 @@ func main() {
 		os.Exit(EXIT_FAILURE)
 	}
 
+	// Only taken for --dry-run's diff: ProcessAll(atomic) takes its own snapshot when it needs
+	// one, and Snapshot() scans every record (see boltDataStore.Snapshot), so skipping it here
+	// keeps a normal run from loading the whole tape into memory.
+	var beforeSnapshot DataStoreSnapshot
+	if dryRun {
+		beforeSnapshot = dataStore.Snapshot()
+	}
+
 	processor := NewCommandProcessor(commands, dataStore)
-	if err := processor.ProcessAll(); err != nil {
+	if err := processor.ProcessAll(atomic); err != nil {
 		fmt.Printf("Problem with executing changes: %v\nList of problems:\n%v\n", err, processor.Errors())
 		os.Exit(EXIT_FAILURE)
 	}
 
+	if warnings := processor.Warnings(); len(warnings) != 0 {
+		fmt.Printf("Completed with warnings:\n%v\n", warnings)
+	}
+
+	if dryRun {
+		for _, line := range diffPlaylists(beforeSnapshot.playlists, dataStore.GetAllPlaylists()) {
+			fmt.Println(line)
+		}
+
+		return
+	}
+
 	if err := dataStore.WriteToFile(dataStoreOutputFilename); err != nil {
 		fmt.Printf("Problem writing data store to file ('%v'): %v\n", dataStoreOutputFilename, err)
 		os.Exit(EXIT_FAILURE)
@@ -43,10 +74,12 @@ func main() {
 /* GetCommandLineArgsOrExit returns the user-supplied command line arguments. If any of the three
 required arguments are missing, a basic usage text will be shown to the user and the program terminates
 with the appropriate exit code. */
-func GetCommandLineArgsOrExit() (dataStoreInputFilename string, dataStoreOutputFilename string, changesFilename string) {
+func GetCommandLineArgsOrExit() (dataStoreInputFilename string, dataStoreOutputFilename string, changesFilename string, atomic bool, dryRun bool) {
 	flag.StringVar(&dataStoreInputFilename, "in", "", "File of data store to read.")
 	flag.StringVar(&dataStoreOutputFilename, "out", "", "File where results of changes will be written.")
 	flag.StringVar(&changesFilename, "changes", "", "File containing the list of changes to apply.")
+	flag.BoolVar(&atomic, "atomic", false, "If set, a failing command reverts every prior mutation in the batch instead of a partial apply.")
+	flag.BoolVar(&dryRun, "dry-run", false, "If set, runs the batch, prints a diff of playlist changes, and skips writing the output file.")
 
 	flag.Parse()
 
@@ -78,3 +111,36 @@ func LoadChangesFile(filename string) ([][]string, error) {
 
 	return commands, nil
 }
+
+/* diffPlaylists compares `before` and `after` by playlist id and returns one line per added
+(`+`), removed (`-`), or changed (`~`) playlist, for use by the `--dry-run` flag. */
+func diffPlaylists(before []Playlist, after []Playlist) []string {
+	beforeById := make(map[string]Playlist, len(before))
+	for _, playlist := range before {
+		beforeById[playlist.Id] = playlist
+	}
+
+	afterById := make(map[string]Playlist, len(after))
+	for _, playlist := range after {
+		afterById[playlist.Id] = playlist
+	}
+
+	var diff []string
+
+	for _, playlist := range after {
+		beforePlaylist, existed := beforeById[playlist.Id]
+		if !existed {
+			diff = append(diff, fmt.Sprintf("+ playlist %v (user %v): %v", playlist.Id, playlist.UserId, playlist.SongIds))
+		} else if !reflect.DeepEqual(beforePlaylist, playlist) {
+			diff = append(diff, fmt.Sprintf("~ playlist %v: %v -> %v", playlist.Id, beforePlaylist.SongIds, playlist.SongIds))
+		}
+	}
+
+	for _, playlist := range before {
+		if _, stillExists := afterById[playlist.Id]; !stillExists {
+			diff = append(diff, fmt.Sprintf("- playlist %v (user %v): %v", playlist.Id, playlist.UserId, playlist.SongIds))
+		}
+	}
+
+	return diff
+}
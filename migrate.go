@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+/* runMigrate implements the `migrate` subcommand: it reads the tape at -in with whichever
+backend NewDataStoreFromFile picks for it, then rewrites the same data to -out as a fresh
+boltDataStore via Snapshot/Restore. This is the only supported way to get an existing tape
+into bbolt: boltDataStore has no command that populates it directly, and Restore is otherwise
+only ever called with a snapshot of the same store (CommandProcessor's atomic rollback). */
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+
+	var inputFilename, outputFilename string
+	fs.StringVar(&inputFilename, "in", "", "File of data store to read (picked by extension, same as the batch CLI).")
+	fs.StringVar(&outputFilename, "out", "", "bbolt file to create/overwrite with the migrated data. Must end in `.db`.")
+
+	fs.Parse(args)
+
+	if inputFilename == "" || outputFilename == "" {
+		fs.Usage()
+		os.Exit(EXIT_USAGE_FAILURE)
+	}
+
+	if !strings.HasSuffix(outputFilename, ".db") {
+		fmt.Printf("-out must be a `.db` file, so a later -in/-changes run picks boltDataStore for it\n")
+		os.Exit(EXIT_USAGE_FAILURE)
+	}
+
+	source, err := NewDataStoreFromFile(inputFilename)
+	if err != nil {
+		fmt.Printf("Problem reading the source data store file ('%v'): %v\n", inputFilename, err)
+		os.Exit(EXIT_FAILURE)
+	}
+
+	os.Remove(outputFilename) // start from an empty bolt file rather than merge into a stale one
+
+	dest, err := newBoltDataStoreFromFile(outputFilename)
+	if err != nil {
+		fmt.Printf("Problem creating the destination data store file ('%v'): %v\n", outputFilename, err)
+		os.Exit(EXIT_FAILURE)
+	}
+
+	dest.Restore(source.Snapshot())
+
+	fmt.Printf("Migrated '%v' to '%v'\n", inputFilename, outputFilename)
+}
@@ -9,6 +9,13 @@ type Playlist struct {
 	Id      string   `json:"id"`
 	UserId  string   `json:"user_id"`
 	SongIds []string `json:"song_ids"`
+
+	// OwnerID is the user id allowed to mutate this playlist (along with any admin - see
+	// jsonDataStore.Admins). It starts out equal to UserId but, unlike UserId, can move to a
+	// different user via TransferPlaylist.
+	OwnerID string `json:"owner_id"`
+	Public  bool   `json:"public,omitempty"`
+	Comment string `json:"comment,omitempty"`
 }
 
 type Song struct {
@@ -16,3 +23,28 @@ type Song struct {
 	Artist string `json:"artist"`
 	Title  string `json:"title"`
 }
+
+// Criteria is a node in a smart playlist's criteria tree. A node is either a leaf, which
+// compares a song's `Field` against `Value` using `Op` (one of "=", "!=", "contains",
+// "startsWith"), or a combinator (`All`, `Any`, `Not`) over other Criteria nodes. Exactly
+// one of these should be set on any given node.
+type Criteria struct {
+	All []Criteria `json:"all,omitempty"`
+	Any []Criteria `json:"any,omitempty"`
+	Not *Criteria  `json:"not,omitempty"`
+
+	Field string `json:"field,omitempty"`
+	Op    string `json:"op,omitempty"`
+	Value string `json:"value"`
+}
+
+// SmartPlaylist is a playlist whose members are computed at read time by evaluating
+// Criteria against the data store's Songs, rather than stored as an explicit SongIds
+// slice like Playlist.
+type SmartPlaylist struct {
+	Id       string   `json:"id"`
+	UserId   string   `json:"user_id"`
+	Criteria Criteria `json:"criteria"`
+	Sort     string   `json:"sort,omitempty"`
+	Limit    int      `json:"limit,omitempty"`
+}
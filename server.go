@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DEFAULT_SERVE_ADDR = ":8080"
+
+/* Server exposes a DataStore as a long-running HTTP API. It reuses CommandProcessor's command
+handlers for every mutation, so the batch CLI and this service never diverge on mutation logic:
+an HTTP request is translated into the same command row a changes file would carry, and run
+through the same CommandProcessor.ProcessCommand.
+
+Requests are serialized by `mu`, since DataStore's slice/map mutations aren't safe for
+concurrent access. Every successful mutation is appended to an on-disk changes journal, so if
+the process crashes, the journal can be replayed against the last snapshot with the existing
+batch CLI (`-in <last snapshot> -changes <journal> -out <recovered tape>`). A snapshot of a
+boltDataStore is named `<-out>.<timestamp>`, which does not end in `.db`, so the batch CLI
+reads it as JSON unless it is first renamed to end in `.db`. Each periodic
+snapshot (see snapshotPeriodically) truncates the journal once it's written, since every
+mutation up to that point is now baked into the snapshot; otherwise replaying the journal
+against that snapshot would double-apply everything already in it. */
+type Server struct {
+	mu          sync.RWMutex
+	processor   CommandProcessor
+	journal     *csv.Writer
+	journalFile *os.File
+}
+
+// NewServer wraps dataStore for HTTP use, opening (and creating, if necessary) the changes
+// journal at journalFilename in append mode.
+func NewServer(dataStore DataStore, journalFilename string) (*Server, error) {
+	journalFile, err := os.OpenFile(journalFilename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't open changes journal file: %v", err)
+	}
+
+	return &Server{
+		processor:   NewCommandProcessor(nil, dataStore),
+		journal:     csv.NewWriter(journalFile),
+		journalFile: journalFile,
+	}, nil
+}
+
+// applyCommand runs command through the same handlers ProcessAll uses for a changes file, and,
+// only on success, appends it to the changes journal.
+func (s *Server) applyCommand(command []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.processor.ProcessCommand(command); err != nil {
+		return err
+	}
+
+	if err := s.journal.Write(command); err != nil {
+		return err
+	}
+	s.journal.Flush()
+
+	return s.journal.Error()
+}
+
+// snapshotPeriodically calls WriteToFile every interval, each time to a new file named
+// outputFilenameBase suffixed with the snapshot's Unix timestamp, so earlier snapshots are
+// never overwritten by a later one. The changes journal is truncated right after each
+// successful snapshot (see snapshotAndTruncateJournal).
+func (s *Server) snapshotPeriodically(outputFilenameBase string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.snapshotAndTruncateJournal(outputFilenameBase); err != nil {
+			fmt.Printf("Problem writing periodic snapshot: %v\n", err)
+		}
+	}
+}
+
+/* snapshotAndTruncateJournal writes a timestamped snapshot of the data store, then truncates
+the changes journal: every mutation up to this point is now baked into the snapshot, so
+replaying the untruncated journal against it later would double-apply every one of those
+mutations (e.g. a second `add-playlist` with a fresh id). The write lock is held across both
+steps so no mutation applied in between is lost from both the snapshot and the journal. */
+func (s *Server) snapshotAndTruncateJournal(outputFilenameBase string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	outputFilename := fmt.Sprintf("%v.%v", outputFilenameBase, time.Now().Unix())
+	if err := s.processor.DataStore.WriteToFile(outputFilename); err != nil {
+		return fmt.Errorf("writing snapshot ('%v'): %v", outputFilename, err)
+	}
+
+	if err := s.journalFile.Truncate(0); err != nil {
+		return fmt.Errorf("truncating journal: %v", err)
+	}
+	if _, err := s.journalFile.Seek(0, 0); err != nil {
+		return fmt.Errorf("seeking journal: %v", err)
+	}
+	s.journal = csv.NewWriter(s.journalFile)
+
+	return nil
+}
+
+// handlePlaylists serves GET/POST /playlists.
+func (s *Server) handlePlaylists(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.RLock()
+		playlists := s.processor.DataStore.GetAllPlaylists()
+		s.mu.RUnlock()
+
+		writeJSON(w, http.StatusOK, playlists)
+
+	case http.MethodPost:
+		var body struct {
+			UserId  string   `json:"user_id"`
+			SongIds []string `json:"song_ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, fmt.Sprintf("Problem parsing request body: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		command := append([]string{ACTING_USER_PREFIX + r.URL.Query().Get("as"), ADD_PLAYLIST, body.UserId}, body.SongIds...)
+		if err := s.applyCommand(command); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePlaylistByPath serves GET/DELETE /playlists/{id} and POST /playlists/{id}/songs.
+// GET resolves a smart playlist's song ids on the fly (via ResolveSmartPlaylist) when
+// playlistId isn't a regular playlist, since smart playlists have no stored SongIds. Regular
+// and smart playlist ids are independent counters (see jsonDataStore.generatePlaylistId and
+// generateSmartPlaylistId), so a regular playlist always wins an id collision between the two.
+func (s *Server) handlePlaylistByPath(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/playlists/"), "/")
+	playlistId := parts[0]
+	if playlistId == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	actingUserId := r.URL.Query().Get("as")
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+
+		if playlist, exists := s.processor.DataStore.GetPlaylist(playlistId); exists {
+			writeJSON(w, http.StatusOK, playlist)
+			return
+		}
+
+		if _, exists := s.processor.DataStore.GetSmartPlaylist(playlistId); !exists {
+			http.NotFound(w, r)
+			return
+		}
+
+		songIds, err := ResolveSmartPlaylist(s.processor.DataStore, playlistId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, songIds)
+
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		command := []string{ACTING_USER_PREFIX + actingUserId, REMOVE_PLAYLIST, playlistId}
+		if err := s.applyCommand(command); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	case len(parts) == 2 && parts[1] == "songs" && r.Method == http.MethodPost:
+		var body struct {
+			SongId string `json:"song_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, fmt.Sprintf("Problem parsing request body: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		command := []string{ACTING_USER_PREFIX + actingUserId, ADD_SONG_TO_PLAYLIST, playlistId, body.SongId}
+		if err := s.applyCommand(command); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleUserPlaylists serves GET /users/{id}/playlists.
+func (s *Server) handleUserPlaylists(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/users/"), "/")
+
+	if r.Method != http.MethodGet || len(parts) != 2 || parts[0] == "" || parts[1] != "playlists" {
+		http.NotFound(w, r)
+		return
+	}
+
+	userId := parts[0]
+
+	s.mu.RLock()
+	var userPlaylists []Playlist
+	for _, playlist := range s.processor.DataStore.GetAllPlaylists() {
+		if playlist.UserId == userId {
+			userPlaylists = append(userPlaylists, playlist)
+		}
+	}
+	s.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, userPlaylists)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+/* runServe implements the `serve` subcommand: it loads the tape at -in once, then serves it
+over HTTP at -addr until killed, journaling every mutation to -journal. If -snapshot-interval
+is set, a periodic snapshot is rotated out to -out on that interval and -journal is truncated
+right after, so -journal only ever holds mutations not yet baked into the latest snapshot. */
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+
+	var inputFilename, outputFilename, journalFilename, addr string
+	var snapshotInterval time.Duration
+
+	fs.StringVar(&inputFilename, "in", "", "File of data store to read.")
+	fs.StringVar(&outputFilename, "out", "", "Base filename periodic snapshots are written to (each is suffixed with its Unix timestamp).")
+	fs.StringVar(&journalFilename, "journal", "", "Append-only changes journal file. Replay it with the batch CLI against the last snapshot to recover from a crash.")
+	fs.StringVar(&addr, "addr", DEFAULT_SERVE_ADDR, "Address to listen on.")
+	fs.DurationVar(&snapshotInterval, "snapshot-interval", 0, "If set, periodically writes a timestamped snapshot to -out (e.g. `5m`). Disabled by default.")
+
+	fs.Parse(args)
+
+	if inputFilename == "" || journalFilename == "" || (snapshotInterval > 0 && outputFilename == "") {
+		fs.Usage()
+		os.Exit(EXIT_USAGE_FAILURE)
+	}
+
+	dataStore, err := NewDataStoreFromFile(inputFilename)
+	if err != nil {
+		fmt.Printf("Problem reading the data store file ('%v'): %v\n", inputFilename, err)
+		os.Exit(EXIT_FAILURE)
+	}
+
+	server, err := NewServer(dataStore, journalFilename)
+	if err != nil {
+		fmt.Printf("Problem starting server: %v\n", err)
+		os.Exit(EXIT_FAILURE)
+	}
+
+	if snapshotInterval > 0 {
+		go server.snapshotPeriodically(outputFilename, snapshotInterval)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/playlists", server.handlePlaylists)
+	mux.HandleFunc("/playlists/", server.handlePlaylistByPath)
+	mux.HandleFunc("/users/", server.handleUserPlaylists)
+
+	fmt.Printf("Listening on %v\n", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		fmt.Printf("HTTP server stopped: %v\n", err)
+		os.Exit(EXIT_FAILURE)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	CRITERIA_OP_EQUALS      = "="
+	CRITERIA_OP_NOT_EQUALS  = "!="
+	CRITERIA_OP_CONTAINS    = "contains"
+	CRITERIA_OP_STARTS_WITH = "startsWith"
+)
+
+/* ResolveSmartPlaylist evaluates a smart playlist's criteria against every song in `ds` and
+returns the matching song IDs, sorted and limited according to its Sort and Limit settings.
+It's a free function rather than a DataStore method because evaluating criteria against
+songs is pure business logic with no need to reach into a backend's storage internals.
+An error is returned if the smart playlist ID doesn't exist, or if its criteria refers to
+an unrecognized field or op. */
+func ResolveSmartPlaylist(ds DataStore, id string) ([]string, error) {
+	smartPlaylist, exists := ds.GetSmartPlaylist(id)
+	if !exists {
+		return nil, fmt.Errorf("The smart playlist id does not exist")
+	}
+
+	var matches []Song
+	for _, song := range ds.GetAllSongs() {
+		matched, err := evaluateCriteria(smartPlaylist.Criteria, song)
+		if err != nil {
+			return nil, err
+		}
+
+		if matched {
+			matches = append(matches, song)
+		}
+	}
+
+	sortSongs(matches, smartPlaylist.Sort)
+
+	if smartPlaylist.Limit > 0 && len(matches) > smartPlaylist.Limit {
+		matches = matches[:smartPlaylist.Limit]
+	}
+
+	songIds := make([]string, len(matches))
+	for i, song := range matches {
+		songIds[i] = song.Id
+	}
+
+	return songIds, nil
+}
+
+/* evaluateCriteria evaluates a Criteria node against a single song, returning whether it
+matches. A node with `All`/`Any`/`Not` set combines the results of other Criteria nodes;
+otherwise the node is treated as a leaf and compares a song field against `Value` via `Op`. */
+func evaluateCriteria(criteria Criteria, song Song) (bool, error) {
+	switch {
+	case len(criteria.All) > 0:
+		for _, subCriteria := range criteria.All {
+			matched, err := evaluateCriteria(subCriteria, song)
+			if err != nil {
+				return false, err
+			}
+			if !matched {
+				return false, nil
+			}
+		}
+		return true, nil
+
+	case len(criteria.Any) > 0:
+		for _, subCriteria := range criteria.Any {
+			matched, err := evaluateCriteria(subCriteria, song)
+			if err != nil {
+				return false, err
+			}
+			if matched {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case criteria.Not != nil:
+		matched, err := evaluateCriteria(*criteria.Not, song)
+		if err != nil {
+			return false, err
+		}
+		return !matched, nil
+
+	default:
+		return evaluateLeafCriteria(criteria, song)
+	}
+}
+
+// evaluateLeafCriteria compares a single song field against criteria.Value using criteria.Op.
+func evaluateLeafCriteria(criteria Criteria, song Song) (bool, error) {
+	fieldValue, err := songFieldValue(song, criteria.Field)
+	if err != nil {
+		return false, err
+	}
+
+	switch criteria.Op {
+	case CRITERIA_OP_EQUALS:
+		return fieldValue == criteria.Value, nil
+	case CRITERIA_OP_NOT_EQUALS:
+		return fieldValue != criteria.Value, nil
+	case CRITERIA_OP_CONTAINS:
+		return strings.Contains(fieldValue, criteria.Value), nil
+	case CRITERIA_OP_STARTS_WITH:
+		return strings.HasPrefix(fieldValue, criteria.Value), nil
+	default:
+		return false, fmt.Errorf("Unrecognized smart playlist criteria op: `%v`", criteria.Op)
+	}
+}
+
+// songFieldValue returns the value of the named Song field, for use as the left-hand side
+// of a criteria comparison.
+func songFieldValue(song Song, field string) (string, error) {
+	switch field {
+	case "artist":
+		return song.Artist, nil
+	case "title":
+		return song.Title, nil
+	case "id":
+		return song.Id, nil
+	default:
+		return "", fmt.Errorf("Unrecognized smart playlist criteria field: `%v`", field)
+	}
+}
+
+/* sortSongs sorts songs in place by the named field ("artist", "title", or "id"). An empty
+or unrecognized field leaves the order unchanged. */
+func sortSongs(songs []Song, field string) {
+	switch field {
+	case "artist":
+		sort.SliceStable(songs, func(i, j int) bool { return songs[i].Artist < songs[j].Artist })
+	case "title":
+		sort.SliceStable(songs, func(i, j int) bool { return songs[i].Title < songs[j].Title })
+	case "id":
+		sort.SliceStable(songs, func(i, j int) bool { return songs[i].Id < songs[j].Id })
+	}
+}
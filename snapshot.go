@@ -0,0 +1,130 @@
+package main
+
+// DataStoreSnapshot is a deep copy of a DataStore's state, captured by Snapshot and handed
+// back to Restore to undo any mutations made in between. It's used by CommandProcessor's
+// atomic mode to roll back a batch of commands if one of them fails partway through.
+type DataStoreSnapshot struct {
+	users          []User
+	playlists      []Playlist
+	smartPlaylists []SmartPlaylist
+	songs          []Song
+	admins         []string
+
+	userMap          map[string]int
+	playlistMap      map[string]int
+	smartPlaylistMap map[string]int
+	songMap          map[string]int
+	songKeyMap       map[string]int
+	adminSet         map[string]bool
+
+	nextPlaylistId      int
+	nextSmartPlaylistId int
+}
+
+/* Snapshot captures a deep copy of the data store's current Users, Playlists, SmartPlaylists,
+Songs, Admins, every lookup map, and the id counters. Pass the result to Restore to undo any
+mutations made since the snapshot was taken. */
+func (ds *jsonDataStore) Snapshot() DataStoreSnapshot {
+	playlists := make([]Playlist, len(ds.Playlists))
+	for i, playlist := range ds.Playlists {
+		playlists[i] = clonePlaylist(playlist)
+	}
+
+	smartPlaylists := make([]SmartPlaylist, len(ds.SmartPlaylists))
+	for i, smartPlaylist := range ds.SmartPlaylists {
+		smartPlaylists[i] = cloneSmartPlaylist(smartPlaylist)
+	}
+
+	return DataStoreSnapshot{
+		users:          append([]User(nil), ds.Users...),
+		playlists:      playlists,
+		smartPlaylists: smartPlaylists,
+		songs:          append([]Song(nil), ds.Songs...),
+		admins:         append([]string(nil), ds.Admins...),
+
+		userMap:          cloneIntMap(ds.userMap),
+		playlistMap:      cloneIntMap(ds.playlistMap),
+		smartPlaylistMap: cloneIntMap(ds.smartPlaylistMap),
+		songMap:          cloneIntMap(ds.songMap),
+		songKeyMap:       cloneIntMap(ds.songKeyMap),
+		adminSet:         cloneBoolMap(ds.adminSet),
+
+		nextPlaylistId:      ds.nextPlaylistId,
+		nextSmartPlaylistId: ds.nextSmartPlaylistId,
+	}
+}
+
+// Restore replaces the data store's state with the given snapshot, undoing any mutations
+// made since it was captured.
+func (ds *jsonDataStore) Restore(snapshot DataStoreSnapshot) {
+	ds.Users = snapshot.users
+	ds.Playlists = snapshot.playlists
+	ds.SmartPlaylists = snapshot.smartPlaylists
+	ds.Songs = snapshot.songs
+	ds.Admins = snapshot.admins
+
+	ds.userMap = snapshot.userMap
+	ds.playlistMap = snapshot.playlistMap
+	ds.smartPlaylistMap = snapshot.smartPlaylistMap
+	ds.songMap = snapshot.songMap
+	ds.songKeyMap = snapshot.songKeyMap
+	ds.adminSet = snapshot.adminSet
+
+	ds.nextPlaylistId = snapshot.nextPlaylistId
+	ds.nextSmartPlaylistId = snapshot.nextSmartPlaylistId
+}
+
+func clonePlaylist(playlist Playlist) Playlist {
+	clone := playlist
+	clone.SongIds = append([]string(nil), playlist.SongIds...)
+	return clone
+}
+
+func cloneSmartPlaylist(smartPlaylist SmartPlaylist) SmartPlaylist {
+	clone := smartPlaylist
+	clone.Criteria = cloneCriteria(smartPlaylist.Criteria)
+	return clone
+}
+
+func cloneCriteria(criteria Criteria) Criteria {
+	clone := criteria
+
+	if criteria.All != nil {
+		clone.All = make([]Criteria, len(criteria.All))
+		for i, subCriteria := range criteria.All {
+			clone.All[i] = cloneCriteria(subCriteria)
+		}
+	}
+
+	if criteria.Any != nil {
+		clone.Any = make([]Criteria, len(criteria.Any))
+		for i, subCriteria := range criteria.Any {
+			clone.Any[i] = cloneCriteria(subCriteria)
+		}
+	}
+
+	if criteria.Not != nil {
+		notClone := cloneCriteria(*criteria.Not)
+		clone.Not = &notClone
+	}
+
+	return clone
+}
+
+func cloneIntMap(m map[string]int) map[string]int {
+	clone := make(map[string]int, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+
+	return clone
+}
+
+func cloneBoolMap(m map[string]bool) map[string]bool {
+	clone := make(map[string]bool, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+
+	return clone
+}